@@ -0,0 +1,116 @@
+/*
+	Copyright (c) 2020, XX Network SEZC
+	All rights reserved.
+	Redistribution and use in source and binary forms, with or without
+	modification, are permitted provided that the following conditions are met:
+	    * Redistributions of source code must retain the above copyright
+	      notice, this list of conditions and the following disclaimer.
+	    * Redistributions in binary form must reproduce the above copyright
+		  notice, this list of conditions and the following disclaimer in the
+		  documentation and/or other materials provided with the distribution.
+		* Neither the name of the <organization> nor the
+		  names of its contributors may be used to endorse or promote products
+		  derived from this software without specific prior written permission.
+	THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+	ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+	WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+	DISCLAIMED. IN NO EVENT SHALL <COPYRIGHT HOLDER> BE LIABLE FOR ANY
+	DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+	(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+	LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+	ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+	(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+	SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package ring
+
+import "sync"
+
+// idLock is a single keyed mutex with a reference count tracking how many
+// callers currently hold or are waiting on it, so IDLocker knows when it is
+// safe to remove the entry.
+type idLock struct {
+	mu  sync.Mutex
+	ref int
+}
+
+// IDLocker hands out per-ID mutexes keyed by the same integer IDs Buff uses,
+// so callers can serialize work on a single ID (e.g. "fetch-or-compute round
+// N, then upsert") without holding Buff's own mutex across that work, and
+// without racing two goroutines that both try to populate the same slot.
+// The map is self-cleaning: once the last waiter releases a keyed lock, its
+// entry is removed so long-running processes don't leak an entry per
+// ever-seen ID.
+type IDLocker struct {
+	mux   sync.Mutex
+	locks map[int]*idLock
+}
+
+// NewIDLocker initializes a new IDLocker
+func NewIDLocker() *IDLocker {
+	return &IDLocker{
+		locks: make(map[int]*idLock),
+	}
+}
+
+// acquire returns the idLock for id, creating it and bumping its refcount if
+// necessary. Must be called with l.mux held.
+func (l *IDLocker) acquire(id int) *idLock {
+	entry, ok := l.locks[id]
+	if !ok {
+		entry = &idLock{}
+		l.locks[id] = entry
+	}
+	entry.ref++
+	return entry
+}
+
+// release drops a reference to the idLock for id, deleting it from the map
+// once the last waiter has gone. Must be called with l.mux held.
+func (l *IDLocker) release(id int, entry *idLock) {
+	entry.ref--
+	if entry.ref == 0 {
+		delete(l.locks, id)
+	}
+}
+
+// LockID locks the mutex associated with id, creating it if it does not yet
+// exist, and returns a function that unlocks it and cleans up the entry if
+// no other caller is waiting on it.
+func (l *IDLocker) LockID(id int) (unlock func()) {
+	l.mux.Lock()
+	entry := l.acquire(id)
+	l.mux.Unlock()
+
+	entry.mu.Lock()
+
+	return func() {
+		entry.mu.Unlock()
+		l.mux.Lock()
+		l.release(id, entry)
+		l.mux.Unlock()
+	}
+}
+
+// TryLockID attempts to lock the mutex associated with id without blocking.
+// It returns false if the lock is already held, in which case unlock is nil.
+func (l *IDLocker) TryLockID(id int) (unlock func(), ok bool) {
+	l.mux.Lock()
+	entry := l.acquire(id)
+	l.mux.Unlock()
+
+	if !entry.mu.TryLock() {
+		l.mux.Lock()
+		l.release(id, entry)
+		l.mux.Unlock()
+		return nil, false
+	}
+
+	return func() {
+		entry.mu.Unlock()
+		l.mux.Lock()
+		l.release(id, entry)
+		l.mux.Unlock()
+	}, true
+}
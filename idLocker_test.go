@@ -0,0 +1,120 @@
+package ring
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestIDLocker_LockID_SerializesSameId(t *testing.T) {
+	l := NewIDLocker()
+
+	var mu sync.Mutex
+	inCriticalSection := false
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := l.LockID(7)
+			defer unlock()
+
+			mu.Lock()
+			if inCriticalSection {
+				t.Error("two goroutines held LockID(7) at the same time")
+			}
+			inCriticalSection = true
+			mu.Unlock()
+
+			mu.Lock()
+			inCriticalSection = false
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if len(l.locks) != 0 {
+		t.Errorf("expected all entries to be cleaned up, got %d remaining", len(l.locks))
+	}
+}
+
+func TestIDLocker_TryLockID(t *testing.T) {
+	l := NewIDLocker()
+
+	unlock, ok := l.TryLockID(1)
+	if !ok {
+		t.Fatal("expected first TryLockID to succeed")
+	}
+
+	if _, ok := l.TryLockID(1); ok {
+		t.Error("expected second TryLockID on the same id to fail while held")
+	}
+
+	unlock()
+
+	unlock2, ok := l.TryLockID(1)
+	if !ok {
+		t.Fatal("expected TryLockID to succeed after unlock")
+	}
+	unlock2()
+}
+
+func TestBuff_UpsertByIdFunc(t *testing.T) {
+	rb := NewBuff[int](10)
+
+	err := rb.UpsertByIdFunc(3, func(existing int) (int, error) {
+		return existing + 1, nil
+	})
+	if err != nil {
+		t.Fatalf("UpsertByIdFunc returned error: %+v", err)
+	}
+
+	val, err := rb.GetById(3)
+	if err != nil {
+		t.Fatalf("GetById returned error: %+v", err)
+	}
+	if val != 1 {
+		t.Errorf("got %d, want 1", val)
+	}
+
+	err = rb.UpsertByIdFunc(3, func(existing int) (int, error) {
+		return existing + 1, nil
+	})
+	if err != nil {
+		t.Fatalf("UpsertByIdFunc returned error: %+v", err)
+	}
+
+	val, err = rb.GetById(3)
+	if err != nil {
+		t.Fatalf("GetById returned error: %+v", err)
+	}
+	if val != 2 {
+		t.Errorf("got %d, want 2", val)
+	}
+}
+
+func TestBuff_UpsertByIdFunc_ConcurrentSameId(t *testing.T) {
+	rb := NewBuff[int](10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = rb.UpsertByIdFunc(0, func(existing int) (int, error) {
+				return existing + 1, nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	val, err := rb.GetById(0)
+	if err != nil {
+		t.Fatalf("GetById returned error: %+v", err)
+	}
+	if val != 50 {
+		t.Errorf("got %d, want 50 (concurrent compute/upsert raced)", val)
+	}
+}
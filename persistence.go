@@ -0,0 +1,362 @@
+/*
+	Copyright (c) 2020, XX Network SEZC
+	All rights reserved.
+	Redistribution and use in source and binary forms, with or without
+	modification, are permitted provided that the following conditions are met:
+	    * Redistributions of source code must retain the above copyright
+	      notice, this list of conditions and the following disclaimer.
+	    * Redistributions in binary form must reproduce the above copyright
+		  notice, this list of conditions and the following disclaimer in the
+		  documentation and/or other materials provided with the distribution.
+		* Neither the name of the <organization> nor the
+		  names of its contributors may be used to endorse or promote products
+		  derived from this software without specific prior written permission.
+	THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+	ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+	WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+	DISCLAIMED. IN NO EVENT SHALL <COPYRIGHT HOLDER> BE LIABLE FOR ANY
+	DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+	(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+	LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+	ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+	(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+	SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package ring
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultPersistQueueSize bounds the channel that feeds the background
+// persistence goroutine, so a burst of Push/UpsertById calls never blocks on
+// disk I/O.
+const defaultPersistQueueSize = 64
+
+// Entry is a single id/value record, as produced by Persister.Load when
+// rehydrating a Buff.
+type Entry[T any] struct {
+	ID  int
+	Val T
+}
+
+// Persister is a pluggable write-through/replay hook for Buff. Save is
+// called at most once for each entry that is actually pushed or upserted
+// with a real value (a write is skipped when the background queue is full,
+// see enqueueSave); the unfilled placeholder slots UpsertById uses to pad a gap
+// are never saved (or notified to subscribers), since they don't represent
+// data a caller ever provided. Load is called once at startup by
+// NewBuffWithPersister to rehydrate buff, oldest, and newest.
+type Persister[T any] interface {
+	Save(id int, val T) error
+	Load() (entries []Entry[T], oldest, newest int, err error)
+}
+
+// saveRequest is a single queued write-through, passed from the goroutine
+// calling Push/UpsertById to the background persistLoop goroutine.
+type saveRequest[T any] struct {
+	id  int
+	val T
+}
+
+// NewBuffWithPersister creates a ring buffer of length n that is immediately
+// rehydrated from p.Load, and that writes through to p on subsequent
+// Push/UpsertById calls. The actual I/O happens on a background goroutine fed
+// by a bounded channel, so Push/UpsertById never block on it; a write that
+// finds the channel full is dropped rather than queued. This lets a
+// long-running service (a round tracker, an update log) resume its recent
+// state after a crash or deploy.
+func NewBuffWithPersister[T any](n int, p Persister[T]) (*Buff[T], error) {
+	entries, oldest, newest, err := p.Load()
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to load persisted ring buffer state")
+	}
+
+	rb := NewBuff[T](n)
+	rb.persister = p
+	rb.saveCh = make(chan saveRequest[T], defaultPersistQueueSize)
+
+	if newest >= 0 {
+		rb.oldest = oldest
+		rb.newest = newest
+		for _, e := range entries {
+			index := e.ID % rb.count
+			rb.buff[index] = e.Val
+			rb.filled[index] = true
+		}
+	}
+
+	go rb.persistLoop()
+
+	return rb, nil
+}
+
+// persistLoop drains saveCh and writes each entry through to the persister.
+// It exits only when saveCh is closed, and nothing closes it: Buff has no
+// Close method, so the goroutine lives for the lifetime of the process, matching the
+// long-running services this is meant for.
+func (rb *Buff[T]) persistLoop() {
+	for req := range rb.saveCh {
+		// Persistence is best-effort from Buff's point of view; a Persister
+		// that needs to surface failures should log or otherwise report
+		// them itself.
+		_ = rb.persister.Save(req.id, req.val)
+	}
+}
+
+// enqueueSave hands id/val to the background persistence goroutine without
+// blocking. If no persister is configured, or the queue is momentarily full,
+// the write is skipped rather than stalling the caller.
+func (rb *Buff[T]) enqueueSave(id int, val T) {
+	if rb.saveCh == nil {
+		return
+	}
+
+	select {
+	case rb.saveCh <- saveRequest[T]{id: id, val: val}:
+	default:
+	}
+}
+
+// NoOpPersister discards every write and reports no prior state. It's meant
+// for tests that exercise NewBuffWithPersister's write-through path without
+// touching disk.
+type NoOpPersister[T any] struct{}
+
+func (NoOpPersister[T]) Save(int, T) error { return nil }
+
+func (NoOpPersister[T]) Load() ([]Entry[T], int, int, error) {
+	return nil, 0, -1, nil
+}
+
+// FilePersister is a reference Persister that appends each entry as a
+// length-prefixed gob record to a file, and periodically compacts the file
+// to keep only the most recent n records.
+type FilePersister[T any] struct {
+	mu sync.Mutex
+
+	path  string
+	file  *os.File
+	count int
+
+	writesSinceCompaction int
+	compactEvery          int
+}
+
+// NewFilePersister opens (creating if necessary) path as the backing store
+// for a ring buffer of length n. compactEvery controls how many Save calls
+// are allowed between compactions; a value <= 0 defaults to 4*n.
+func NewFilePersister[T any](path string, n int, compactEvery int) (*FilePersister[T], error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to open ring buffer persistence file")
+	}
+
+	if compactEvery <= 0 {
+		compactEvery = 4 * n
+	}
+
+	return &FilePersister[T]{
+		path:         path,
+		file:         f,
+		count:        n,
+		compactEvery: compactEvery,
+	}, nil
+}
+
+// Save appends val as a new record for id, compacting the file once
+// compactEvery records have been appended since the last compaction.
+func (p *FilePersister[T]) Save(id int, val T) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := writeRecord(p.file, Entry[T]{ID: id, Val: val}); err != nil {
+		return errors.WithMessage(err, "failed to append ring buffer record")
+	}
+
+	p.writesSinceCompaction++
+	if p.writesSinceCompaction >= p.compactEvery {
+		if err := p.compact(); err != nil {
+			return errors.WithMessage(err, "failed to compact ring buffer persistence file")
+		}
+	}
+
+	return nil
+}
+
+// Load replays the file, keeping only the most recent record per ID, and
+// returns the entries that fall within the most recent n IDs.
+func (p *FilePersister[T]) Load() ([]Entry[T], int, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	latest, err := p.scanLatest()
+	if err != nil {
+		return nil, 0, -1, errors.WithMessage(err, "failed to read ring buffer persistence file")
+	}
+
+	if len(latest) == 0 {
+		return nil, 0, -1, nil
+	}
+
+	newest := math.MinInt
+	for id := range latest {
+		if id > newest {
+			newest = id
+		}
+	}
+	oldest := newest - p.count + 1
+	if oldest < 0 {
+		oldest = 0
+	}
+
+	entries := make([]Entry[T], 0, len(latest))
+	for id, val := range latest {
+		if id < oldest {
+			continue
+		}
+		entries = append(entries, Entry[T]{ID: id, Val: val})
+	}
+
+	return entries, oldest, newest, nil
+}
+
+// scanLatest reads every record in the file from the start and returns the
+// most recently written value for each ID, leaving the file positioned at
+// EOF for further appends. Must be called with p.mu held.
+func (p *FilePersister[T]) scanLatest() (map[int]T, error) {
+	if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	latest := make(map[int]T)
+	r := bufio.NewReader(p.file)
+	for {
+		entry, err := readRecord[T](r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		latest[entry.ID] = entry.Val
+	}
+
+	if _, err := p.file.Seek(0, io.SeekEnd); err != nil {
+		return nil, err
+	}
+
+	return latest, nil
+}
+
+// compact rewrites the file so it holds only the latest record for each of
+// the most recent p.count IDs. Must be called with p.mu held.
+func (p *FilePersister[T]) compact() error {
+	latest, err := p.scanLatest()
+	if err != nil {
+		return err
+	}
+
+	if len(latest) == 0 {
+		p.writesSinceCompaction = 0
+		return nil
+	}
+
+	newest := math.MinInt
+	for id := range latest {
+		if id > newest {
+			newest = id
+		}
+	}
+	oldest := newest - p.count + 1
+	if oldest < 0 {
+		oldest = 0
+	}
+
+	tmpPath := p.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	for id, val := range latest {
+		if id < oldest {
+			continue
+		}
+		if err := writeRecord(tmp, Entry[T]{ID: id, Val: val}); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(p.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	p.file = f
+	p.writesSinceCompaction = 0
+	return nil
+}
+
+// writeRecord appends a single length-prefixed gob record to w.
+func writeRecord[T any](w io.Writer, e Entry[T]) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return err
+	}
+
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(buf.Len()))
+
+	if _, err := w.Write(lenPrefix[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// readRecord reads a single length-prefixed gob record from r, returning
+// io.EOF when r holds no further data and io.ErrUnexpectedEOF when the
+// trailing record is truncated.
+func readRecord[T any](r io.Reader) (Entry[T], error) {
+	var entry Entry[T]
+
+	var lenPrefix [4]byte
+	if _, err := io.ReadFull(r, lenPrefix[:]); err != nil {
+		return entry, err
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(lenPrefix[:]))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return entry, io.ErrUnexpectedEOF
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return entry, err
+	}
+
+	return entry, nil
+}
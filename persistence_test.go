@@ -0,0 +1,153 @@
+package ring
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Regression test: when fewer than n records have ever been saved,
+// FilePersister.Load must not return a negative oldest, which would
+// otherwise crash GetAll/Range with a negative slice index once copied into
+// Buff.
+func TestNewBuffWithPersister_PartiallyFilled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.db")
+
+	p, err := NewFilePersister[int](path, 10, 0)
+	if err != nil {
+		t.Fatalf("NewFilePersister returned error: %+v", err)
+	}
+
+	for id := 0; id < 3; id++ {
+		if err := p.Save(id, id*10); err != nil {
+			t.Fatalf("Save returned error: %+v", err)
+		}
+	}
+
+	rb, err := NewBuffWithPersister[int](10, p)
+	if err != nil {
+		t.Fatalf("NewBuffWithPersister returned error: %+v", err)
+	}
+
+	if oldest := rb.GetOldestId(); oldest < 0 {
+		t.Fatalf("GetOldestId() = %d, want >= 0", oldest)
+	}
+
+	got := rb.GetAll()
+	expected := []int{0, 10, 20}
+	if len(got) != len(expected) {
+		t.Fatalf("GetAll() = %v, want %v", got, expected)
+	}
+	for i, v := range expected {
+		if got[i] != v {
+			t.Errorf("GetAll()[%d] = %d, want %d", i, got[i], v)
+		}
+	}
+}
+
+// TestBuff_FilePersister_WriteThroughAndReload exercises the actual async
+// path (Push -> enqueueSave -> persistLoop -> FilePersister.Save) rather
+// than calling Save directly, then confirms a fresh FilePersister pointed at
+// the same file can reload what the background goroutine wrote.
+func TestBuff_FilePersister_WriteThroughAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.db")
+
+	p, err := NewFilePersister[int](path, 5, 0)
+	if err != nil {
+		t.Fatalf("NewFilePersister returned error: %+v", err)
+	}
+
+	rb, err := NewBuffWithPersister[int](5, p)
+	if err != nil {
+		t.Fatalf("NewBuffWithPersister returned error: %+v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		rb.Push(i * 100)
+	}
+
+	// The writes happen on a background goroutine; poll a fresh reader of
+	// the same file until it catches up instead of reaching into rb's
+	// internals.
+	var entries []Entry[int]
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		reader, err := NewFilePersister[int](path, 5, 0)
+		if err != nil {
+			t.Fatalf("NewFilePersister returned error: %+v", err)
+		}
+		got, _, newest, err := reader.Load()
+		if err != nil {
+			t.Fatalf("Load returned error: %+v", err)
+		}
+		if newest == 4 {
+			entries = got
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if entries == nil {
+		t.Fatal("timed out waiting for background persistence to catch up with Push")
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	for i, e := range entries {
+		if e.ID != i || e.Val != i*100 {
+			t.Errorf("entries[%d] = %+v, want {ID: %d, Val: %d}", i, e, i, i*100)
+		}
+	}
+}
+
+// TestFilePersister_Compacts verifies that once enough records have been
+// saved to trigger compaction, Load still returns exactly the most recent n
+// entries by replaying the rewritten (renamed/reopened) file.
+func TestFilePersister_Compacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.db")
+
+	p, err := NewFilePersister[int](path, 3, 2)
+	if err != nil {
+		t.Fatalf("NewFilePersister returned error: %+v", err)
+	}
+
+	for id := 0; id < 10; id++ {
+		if err := p.Save(id, id*10); err != nil {
+			t.Fatalf("Save returned error: %+v", err)
+		}
+	}
+
+	entries, oldest, newest, err := p.Load()
+	if err != nil {
+		t.Fatalf("Load returned error: %+v", err)
+	}
+	if newest != 9 {
+		t.Fatalf("newest = %d, want 9", newest)
+	}
+	if oldest != 7 {
+		t.Fatalf("oldest = %d, want 7", oldest)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	for i, want := range []int{7, 8, 9} {
+		if entries[i].ID != want || entries[i].Val != want*10 {
+			t.Errorf("entries[%d] = %+v, want {ID: %d, Val: %d}", i, entries[i], want, want*10)
+		}
+	}
+}
+
+func TestNewBuffWithPersister_NoOp(t *testing.T) {
+	rb, err := NewBuffWithPersister[int](10, NoOpPersister[int]{})
+	if err != nil {
+		t.Fatalf("NewBuffWithPersister returned error: %+v", err)
+	}
+
+	rb.Push(1)
+	rb.Push(2)
+
+	if got := rb.GetAll(); len(got) != 2 {
+		t.Errorf("GetAll() = %v, want 2 entries", got)
+	}
+}
@@ -28,7 +28,8 @@ package ring
 /*
  * The RingBuffer data structure is used to store information on rounds and updates
  * It functions like a typical Circluar buffer, with some slight modifications
- * First, it is made generic by using interface{} instead of a defined type
+ * First, it is made generic over the type of element it stores, so callers get back
+ * concrete values instead of interface{} and runtime type assertions
  * Second, it requires an id function to be passed in which gets an ID from whatever the underlying object is
  * Finally, it allows for manipulation of data using both normal indeces and ID values as counters
  */
@@ -39,25 +40,37 @@ import (
 )
 
 // A circular buffer with the ability to use IDs as position and locks built in
-type Buff struct {
-	buff                  []interface{}
+type Buff[T any] struct {
+	buff                  []T
+	filled                []bool
 	count, oldest, newest int
 	mux                   sync.RWMutex
+	ids                   *IDLocker
+
+	subMux    sync.Mutex
+	subs      map[int]*subscription
+	nextSubId int
+
+	persister Persister[T]
+	saveCh    chan saveRequest[T]
 }
 
 // Initialize a new ring buffer with length n
-func NewBuff(n int) *Buff {
-	rb := &Buff{
-		buff:   make([]interface{}, n),
+func NewBuff[T any](n int) *Buff[T] {
+	rb := &Buff[T]{
+		buff:   make([]T, n),
+		filled: make([]bool, n),
 		count:  n,
 		oldest: 0,
 		newest: -1,
+		ids:    NewIDLocker(),
+		subs:   make(map[int]*subscription),
 	}
 	return rb
 }
 
 // Get the ID of the newest item in the buffer
-func (rb *Buff) GetNewestId() int {
+func (rb *Buff[T]) GetNewestId() int {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -65,7 +78,7 @@ func (rb *Buff) GetNewestId() int {
 }
 
 // Get the IDof the oldest item in the buffer
-func (rb *Buff) GetOldestId() int {
+func (rb *Buff[T]) GetOldestId() int {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -73,7 +86,7 @@ func (rb *Buff) GetOldestId() int {
 }
 
 // Push a round to the buffer
-func (rb *Buff) Push(val interface{}) {
+func (rb *Buff[T]) Push(val T) {
 	rb.mux.Lock()
 	defer rb.mux.Unlock()
 
@@ -81,7 +94,7 @@ func (rb *Buff) Push(val interface{}) {
 }
 
 // push a round to a relative index in the buffer
-func (rb *Buff) UpsertById(newId int, val interface{}) error {
+func (rb *Buff[T]) UpsertById(newId int, val T) error {
 	rb.mux.Lock()
 	defer rb.mux.Unlock()
 
@@ -90,23 +103,73 @@ func (rb *Buff) UpsertById(newId int, val interface{}) error {
 		return errors.Errorf("Did not upsert value %+v; id is older than first tracked", val)
 	}
 
+	// Remember whether this call actually advances newest, so we only
+	// notify subscribers of a genuinely forward-moving ID below
+	origNewest := rb.newest
+
 	// Get most recent ID so we can figure out where to put this
 	firstEmptyID := rb.newest + 1
 
-	//fill the buffer up until the newID
+	//pad the gap up until the newID with empty, unfilled slots; these are
+	//not real entries, so they must not be reported as filled, notified to
+	//subscribers, or persisted
 	for i := firstEmptyID; i <= newId; i++ {
-		rb.push(nil)
+		rb.padGap()
 	}
 
 	//add the data at the correct location
 	index := newId % rb.count
+	wasFilled := rb.filled[index]
 	rb.buff[index] = val
+	rb.filled[index] = true
+
+	// Notify subscribers (e.g. WaitForId) whenever this call causes newId to
+	// become present for the first time: either it genuinely advances
+	// newest, or it's filling in an ID that was previously only padded by an
+	// earlier forward jump. A plain historical overwrite of an already-filled
+	// slot is neither, so it stays silent.
+	if newId > origNewest || !wasFilled {
+		rb.notifySubscribers(newId)
+	}
+	rb.enqueueSave(newId, val)
 
 	return nil
 }
 
+// padGap advances the buffer by one slot without marking it filled, used by
+// UpsertById to skip over IDs it isn't given a value for. The slot is
+// cleared explicitly since the ring may be reusing an index that previously
+// held a real, filled entry.
+func (rb *Buff[T]) padGap() {
+	rb.next()
+	index := rb.newest % rb.count
+	var zero T
+	rb.buff[index] = zero
+	rb.filled[index] = false
+}
+
+// UpsertByIdFunc takes the per-ID lock for id, reads the current value at
+// that ID (the zero value of T if it is not yet present), runs compute on
+// it outside of any Buff lock, and writes the result back via UpsertById.
+// This is the common "read round metadata, maybe recompute it, write it
+// back" pattern, without serializing unrelated IDs against each other or
+// holding Buff's own mutex across potentially expensive work in compute.
+func (rb *Buff[T]) UpsertByIdFunc(id int, compute func(existing T) (T, error)) error {
+	unlock := rb.ids.LockID(id)
+	defer unlock()
+
+	existing, _ := rb.GetById(id)
+
+	updated, err := compute(existing)
+	if err != nil {
+		return err
+	}
+
+	return rb.UpsertById(id, updated)
+}
+
 // Retreive the most recent entry
-func (rb *Buff) Get() interface{} {
+func (rb *Buff[T]) Get() T {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -115,7 +178,7 @@ func (rb *Buff) Get() interface{} {
 }
 
 // Retrieve an entry with the given ID
-func (rb *Buff) GetById(id int) (interface{}, error) {
+func (rb *Buff[T]) GetById(id int) (T, error) {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -123,19 +186,20 @@ func (rb *Buff) GetById(id int) (interface{}, error) {
 }
 
 // Retrieve an entry at the given index
-func (rb *Buff) GetByIndex(i int) (interface{}, error) {
+func (rb *Buff[T]) GetByIndex(i int) (T, error) {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
+	var zero T
 	if i < 0 || i >= rb.count {
-		return nil, errors.Errorf("Could not get item at index %d: index out of bounds", i)
+		return zero, errors.Errorf("Could not get item at index %d: index out of bounds", i)
 	}
 
 	return rb.buff[i], nil
 }
 
 //retrieve all entries newer than the passed one
-func (rb *Buff) GetNewerById(id int) ([]interface{}, error) {
+func (rb *Buff[T]) GetNewerById(id int) ([]T, error) {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -148,7 +212,7 @@ func (rb *Buff) GetNewerById(id int) ([]interface{}, error) {
 			" newest id %d", id, rb.newest)
 	}
 
-	list := make([]interface{}, rb.newest-id)
+	list := make([]T, rb.newest-id)
 
 	for i := id + 1; i <= rb.newest; i++ {
 		//error is suppressed because it only occurs when out of bounds,
@@ -159,8 +223,54 @@ func (rb *Buff) GetNewerById(id int) ([]interface{}, error) {
 	return list, nil
 }
 
+// GetAll returns a copy of every live entry in the buffer, ordered from
+// oldest to newest, under a single read lock. This lets callers atomically
+// inspect the whole buffer rather than racing a series of GetById calls
+// against concurrent Push/UpsertById calls.
+func (rb *Buff[T]) GetAll() []T {
+	rb.mux.RLock()
+	defer rb.mux.RUnlock()
+
+	if rb.newest == -1 {
+		return nil
+	}
+
+	list := make([]T, 0, rb.newest-rb.oldest+1)
+	for i := rb.oldest; i <= rb.newest; i++ {
+		index := i % rb.count
+		if rb.filled[index] {
+			list = append(list, rb.buff[index])
+		}
+	}
+
+	return list
+}
+
+// Range iterates over every live entry in the buffer from oldest to newest
+// while holding the read lock, calling f for each one. Iteration stops early
+// if f returns false. Unlike GetAll, Range does not allocate a slice, making
+// it suitable for callers that just want to scan for a match.
+func (rb *Buff[T]) Range(f func(id int, val T) bool) {
+	rb.mux.RLock()
+	defer rb.mux.RUnlock()
+
+	if rb.newest == -1 {
+		return
+	}
+
+	for i := rb.oldest; i <= rb.newest; i++ {
+		index := i % rb.count
+		if !rb.filled[index] {
+			continue
+		}
+		if !f(i, rb.buff[index]) {
+			return
+		}
+	}
+}
+
 // Return length of the structure
-func (rb *Buff) Len() int {
+func (rb *Buff[T]) Len() int {
 	rb.mux.RLock()
 	defer rb.mux.RUnlock()
 
@@ -169,7 +279,7 @@ func (rb *Buff) Len() int {
 
 // next is a helper function for ringbuff
 // it handles incrementing the old & new markers
-func (rb *Buff) next() {
+func (rb *Buff[T]) next() {
 	rb.newest++
 	if rb.newest >= rb.count {
 		rb.oldest++
@@ -177,24 +287,45 @@ func (rb *Buff) next() {
 }
 
 // Push a round to the buffer
-func (rb *Buff) push(val interface{}) {
+func (rb *Buff[T]) push(val T) {
 	rb.next()
-	rb.buff[rb.newest%rb.count] = val
+	index := rb.newest % rb.count
+	rb.buff[index] = val
+	rb.filled[index] = true
+	rb.notifySubscribers(rb.newest)
+	rb.enqueueSave(rb.newest, val)
 }
 
 // Retrieve an entry with the given ID for internal use without getting the read
 // lock
-func (rb *Buff) getById(id int) (interface{}, error) {
+func (rb *Buff[T]) getById(id int) (T, error) {
+	var zero T
 
 	// Check it's not before our first known id
 	if id < rb.oldest {
-		return nil, errors.Errorf("requested ID %d is lower than oldest id %d", id, rb.newest)
+		return zero, errors.Errorf("requested ID %d is lower than oldest id %d", id, rb.oldest)
 	}
 
 	// Check it's not after our last known id
 	if id > rb.newest {
-		return nil, errors.Errorf("requested id %d is higher than most recent id %d", id, rb.oldest)
+		return zero, errors.Errorf("requested id %d is higher than most recent id %d", id, rb.newest)
+	}
+
+	index := id % rb.count
+	if !rb.filled[index] {
+		return zero, nil
 	}
 
-	return rb.buff[id%rb.count], nil
+	return rb.buff[index], nil
+}
+
+// isFilled reports whether id is both in range and holds a real, pushed or
+// upserted value, as opposed to a slot that UpsertById has only padded over
+// on its way to a later ID. Must be called with the read lock (or write
+// lock) held.
+func (rb *Buff[T]) isFilled(id int) bool {
+	if id < rb.oldest || id > rb.newest {
+		return false
+	}
+	return rb.filled[id%rb.count]
 }
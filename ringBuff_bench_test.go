@@ -0,0 +1,40 @@
+package ring
+
+import "testing"
+
+// roundInfo is a small value type used to demonstrate that pushing
+// concrete structs into Buff no longer incurs interface boxing.
+type roundInfo struct {
+	id    int
+	state uint8
+}
+
+func BenchmarkBuffPush_Generic(b *testing.B) {
+	rb := NewBuff[roundInfo](2048)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Push(roundInfo{id: i, state: uint8(i)})
+	}
+}
+
+func BenchmarkBuffPush_Interface(b *testing.B) {
+	rb := NewBuff[interface{}](2048)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rb.Push(roundInfo{id: i, state: uint8(i)})
+	}
+}
+
+func BenchmarkBuffGetById_Generic(b *testing.B) {
+	rb := NewBuff[roundInfo](2048)
+	for i := 0; i < 2048; i++ {
+		rb.Push(roundInfo{id: i, state: uint8(i)})
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = rb.GetById(rb.GetNewestId())
+	}
+}
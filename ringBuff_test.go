@@ -0,0 +1,74 @@
+package ring
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Regression test: UpsertById pads any gap between the current newest and
+// the target ID with unfilled slots, not real zero-valued entries, so
+// GetAll/Range must not surface them.
+func TestBuff_GetAll_SkipsGapPaddedSlots(t *testing.T) {
+	rb := NewBuff[int](10)
+
+	if err := rb.UpsertById(5, 99); err != nil {
+		t.Fatalf("UpsertById returned error: %+v", err)
+	}
+
+	got := rb.GetAll()
+	expected := []int{99}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAll() = %v, want %v", got, expected)
+	}
+}
+
+func TestBuff_Range_SkipsGapPaddedSlots(t *testing.T) {
+	rb := NewBuff[int](10)
+
+	if err := rb.UpsertById(5, 99); err != nil {
+		t.Fatalf("UpsertById returned error: %+v", err)
+	}
+
+	var seen []int
+	rb.Range(func(id int, val int) bool {
+		seen = append(seen, id)
+		return true
+	})
+
+	expected := []int{5}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Range visited ids %v, want %v", seen, expected)
+	}
+}
+
+func TestBuff_GetAll_OrdersOldestToNewest(t *testing.T) {
+	rb := NewBuff[int](3)
+	rb.Push(1)
+	rb.Push(2)
+	rb.Push(3)
+	rb.Push(4) // wraps, evicting 1
+
+	got := rb.GetAll()
+	expected := []int{2, 3, 4}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("GetAll() = %v, want %v", got, expected)
+	}
+}
+
+func TestBuff_Range_StopsEarly(t *testing.T) {
+	rb := NewBuff[int](5)
+	rb.Push(1)
+	rb.Push(2)
+	rb.Push(3)
+
+	var seen []int
+	rb.Range(func(id int, val int) bool {
+		seen = append(seen, val)
+		return val != 2
+	})
+
+	expected := []int{1, 2}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Range visited %v, want %v", seen, expected)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+	Copyright (c) 2020, XX Network SEZC
+	All rights reserved.
+	Redistribution and use in source and binary forms, with or without
+	modification, are permitted provided that the following conditions are met:
+	    * Redistributions of source code must retain the above copyright
+	      notice, this list of conditions and the following disclaimer.
+	    * Redistributions in binary form must reproduce the above copyright
+		  notice, this list of conditions and the following disclaimer in the
+		  documentation and/or other materials provided with the distribution.
+		* Neither the name of the <organization> nor the
+		  names of its contributors may be used to endorse or promote products
+		  derived from this software without specific prior written permission.
+	THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND
+	ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED
+	WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+	DISCLAIMED. IN NO EVENT SHALL <COPYRIGHT HOLDER> BE LIABLE FOR ANY
+	DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES
+	(INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES;
+	LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND
+	ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+	(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS
+	SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+*/
+
+package ring
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// subscriberBufferSize is the capacity of the per-subscriber notification
+// ring. It is kept small because the channel only ever carries IDs (or a
+// Lagged sentinel); consumers are expected to fetch the actual values with
+// GetById/GetNewerById.
+const subscriberBufferSize = 16
+
+// Lagged returns the sentinel value delivered on a subscription channel when
+// a slow consumer causes the per-subscriber ring to drop pending
+// notifications. n is the number of notifications that were collapsed into
+// the sentinel. Callers should treat receipt of a negative value as "one or
+// more pushes were missed; call GetNewerById to resync" rather than as a
+// real ID.
+func Lagged(n int) int {
+	if n < 1 {
+		n = 1
+	}
+	return -n
+}
+
+// subscription is the delivery side of a single Subscribe call: a small
+// non-blocking ring of pending IDs that drops the oldest entry (replacing it
+// with a Lagged sentinel) rather than blocking Push when a consumer falls
+// behind.
+type subscription struct {
+	mu     sync.Mutex
+	ch     chan int
+	missed int
+}
+
+// notify delivers id to the subscriber without blocking. If the ring is
+// full, the oldest pending notification is dropped and replaced with a
+// Lagged sentinel the next time there is room to send one.
+func (s *subscription) notify(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.missed > 0 {
+		select {
+		case s.ch <- Lagged(s.missed):
+			s.missed = 0
+		default:
+			s.missed++
+			return
+		}
+	}
+
+	select {
+	case s.ch <- id:
+		return
+	default:
+	}
+
+	select {
+	case <-s.ch:
+	default:
+	}
+	s.missed++
+}
+
+// notifySubscribers delivers id to every currently-subscribed channel.
+func (rb *Buff[T]) notifySubscribers(id int) {
+	rb.subMux.Lock()
+	defer rb.subMux.Unlock()
+
+	for _, sub := range rb.subs {
+		sub.notify(id)
+	}
+}
+
+// Subscribe returns a channel that receives the ID of every entry pushed (or
+// upserted forward) with an ID greater than fromId, along with a function
+// that unsubscribes and releases the channel's resources. Any IDs already
+// present and greater than fromId at the time of the call are delivered
+// first, so a caller cannot miss a push that happened just before it
+// subscribed.
+//
+// Delivery is non-blocking: a subscriber that falls behind will see pending
+// notifications collapsed into a Lagged sentinel (see Lagged) rather than
+// stalling Push.
+func (rb *Buff[T]) Subscribe(fromId int) (<-chan int, func()) {
+	sub := &subscription{ch: make(chan int, subscriberBufferSize)}
+
+	// Hold the read lock across both registering the subscription and
+	// replaying the backlog, so a Push/UpsertById (which needs the write
+	// lock) can't land in between and be missed: it either lands before we
+	// register (and is covered by the backlog replay below) or after we
+	// release the read lock (and is covered by notifySubscribers, since the
+	// subscriber is already registered by then).
+	rb.mux.RLock()
+
+	rb.subMux.Lock()
+	id := rb.nextSubId
+	rb.nextSubId++
+	rb.subs[id] = sub
+	rb.subMux.Unlock()
+
+	start := fromId
+	if start < rb.oldest-1 {
+		start = rb.oldest - 1
+	}
+	for pushedId := start + 1; pushedId <= rb.newest; pushedId++ {
+		if rb.isFilled(pushedId) {
+			sub.notify(pushedId)
+		}
+	}
+	rb.mux.RUnlock()
+
+	unsubscribe := func() {
+		rb.subMux.Lock()
+		delete(rb.subs, id)
+		rb.subMux.Unlock()
+	}
+
+	return sub.ch, unsubscribe
+}
+
+// WaitForId blocks until the entry with the given ID is present in the
+// buffer or ctx is done. This is the primitive most callers actually want
+// when they know the ID they're waiting on but don't want to poll
+// GetNewestId in a loop.
+func (rb *Buff[T]) WaitForId(ctx context.Context, id int) (T, error) {
+	rb.mux.RLock()
+	filled := rb.isFilled(id)
+	rb.mux.RUnlock()
+	if filled {
+		return rb.GetById(id)
+	}
+
+	ch, unsubscribe := rb.Subscribe(id - 1)
+	defer unsubscribe()
+
+	var zero T
+	for {
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case gotId, ok := <-ch:
+			if !ok {
+				return zero, errors.Errorf("subscription closed while waiting for id %d", id)
+			}
+			if gotId < 0 {
+				// we lagged behind the notification stream; fall back to a
+				// direct check rather than trusting the (now stale) IDs
+				gotId = id
+			}
+			if gotId < id {
+				continue
+			}
+
+			rb.mux.RLock()
+			filled := rb.isFilled(id)
+			rb.mux.RUnlock()
+			if filled {
+				return rb.GetById(id)
+			}
+			// id is still only a gap-padded placeholder (a later ID was
+			// pushed/forward-filled past it); keep waiting for the
+			// notification that fills it in for real
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ring
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestBuff_Subscribe_NoMissedPush checks that a Push made right after
+// Subscribe returns is delivered on the subscription channel. It runs
+// sequentially, so it does not itself exercise a Push racing with
+// Subscribe's registration and backlog replay.
+func TestBuff_Subscribe_NoMissedPush(t *testing.T) {
+	rb := NewBuff[int](16)
+	rb.Push(0)
+
+	ch, unsubscribe := rb.Subscribe(rb.GetNewestId())
+	defer unsubscribe()
+
+	rb.Push(1)
+
+	select {
+	case id := <-ch:
+		if id != 1 {
+			t.Errorf("got id %d, want 1", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for notification of a push after Subscribe")
+	}
+}
+
+func TestBuff_Subscribe_ReplaysBacklog(t *testing.T) {
+	rb := NewBuff[int](16)
+	rb.Push(0)
+	rb.Push(1)
+	rb.Push(2)
+
+	ch, unsubscribe := rb.Subscribe(0)
+	defer unsubscribe()
+
+	for _, want := range []int{1, 2} {
+		select {
+		case id := <-ch:
+			if id != want {
+				t.Errorf("got id %d, want %d", id, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for backlog id %d", want)
+		}
+	}
+}
+
+func TestBuff_WaitForId_ConcurrentPush(t *testing.T) {
+	rb := NewBuff[int](16)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(10 * time.Millisecond)
+		rb.Push(42)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	val, err := rb.WaitForId(ctx, 0)
+	if err != nil {
+		t.Fatalf("WaitForId returned error: %+v", err)
+	}
+	if val != 42 {
+		t.Errorf("got %d, want 42", val)
+	}
+
+	wg.Wait()
+}
+
+// TestBuff_WaitForId_SkipsGapPaddedId guards against treating an in-range
+// but merely gap-padded ID as present: a forward jump past the waited-for ID
+// must not make WaitForId return a phantom zero value, and the waiter must
+// still be woken once the padded slot is actually filled in.
+func TestBuff_WaitForId_SkipsGapPaddedId(t *testing.T) {
+	rb := NewBuff[int](16)
+	rb.Push(0)
+	rb.Push(1)
+	rb.Push(2)
+	rb.Push(3)
+
+	type result struct {
+		val int
+		err error
+	}
+	done := make(chan result, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	go func() {
+		val, err := rb.WaitForId(ctx, 7)
+		done <- result{val, err}
+	}()
+
+	// This jumps from newest=3 straight to 10, padding 4-9 (including the
+	// waited-for id 7) as unfilled placeholders.
+	if err := rb.UpsertById(10, 1000); err != nil {
+		t.Fatalf("UpsertById returned error: %+v", err)
+	}
+
+	select {
+	case r := <-done:
+		t.Fatalf("WaitForId(ctx, 7) returned early with (%d, %v) after only a gap-padding jump past 7", r.val, r.err)
+	case <-time.After(100 * time.Millisecond):
+		// expected: still waiting
+	}
+
+	if err := rb.UpsertById(7, 777); err != nil {
+		t.Fatalf("UpsertById returned error: %+v", err)
+	}
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			t.Fatalf("WaitForId returned error: %+v", r.err)
+		}
+		if r.val != 777 {
+			t.Errorf("got %d, want 777", r.val)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for WaitForId to return after the gap was backfilled")
+	}
+}
+
+func TestBuff_WaitForId_ContextCanceled(t *testing.T) {
+	rb := NewBuff[int](16)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := rb.WaitForId(ctx, 5)
+	if err == nil {
+		t.Fatal("expected an error from WaitForId when the context is done")
+	}
+}